@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// BenchmarkShardWriteAllocs isolates the steady-state append path
+// (Shard.write) from JSON decoding, mirroring the fasthttp style of
+// asserting a hot inner loop is allocation-free once its pools and
+// cached *os.File have warmed up.
+func BenchmarkShardWriteAllocs(b *testing.B) {
+	dataDir := b.TempDir() + "/"
+	shard := newShard()
+	readings := &Readings{Sensor_id: 1, Readings: []Reading{{Timestamp: "2020-01-01T00:00:00Z", Value: 1}}}
+
+	// warm the cached file handle and the bufio.Writer pool before
+	// measuring, since the request only cares about steady state
+	if err := shard.write(readings, &dataDir); err != nil {
+		b.Fatal(err)
+	}
+
+	allocs := testing.AllocsPerRun(b.N, func() {
+		if err := shard.write(readings, &dataDir); err != nil {
+			b.Fatal(err)
+		}
+	})
+	if allocs > 0 {
+		b.Fatalf("expected zero allocations on the steady-state write path, got %.2f", allocs)
+	}
+}
+
+// BenchmarkPostReadingAllocs reports end-to-end allocations for
+// postReading, including JSON decode, so the effect of pooling is
+// visible against the pre-pooling baseline even though a handful of
+// allocations (string fields copied out of the request body) are
+// unavoidable without a custom decoder.
+func BenchmarkPostReadingAllocs(b *testing.B) {
+	setupShardPool(b, 1)
+	body := postBody(0, 1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/readings", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		var rw http.ResponseWriter = w
+		postReading(&rw, req)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotateThreshold is the live file size (bytes) past which write()
+// rotates a sensor's file into a compressed segment. 0 disables
+// rotation entirely.
+var rotateThreshold int64
+
+// compressionLevel is the compress/flate level used when rotating
+// segments. Sensor readings are highly repetitive (shared timestamp
+// prefixes, clustered values), so even flate.BestSpeed buys a lot of
+// disk back for very little CPU; flate.HuffmanOnly trades away LZ
+// matching entirely and is worth trying when a sensor's values are
+// numeric noise with little repeated structure.
+var compressionLevel = flate.BestSpeed
+
+// maybeRotate renames a sensor's live file to a numbered segment and
+// compresses it if it has grown past rotateThreshold. It's always
+// called from within the owning shard's single goroutine right after a
+// write, so no extra locking is needed here. The sensor's cached file
+// handle is closed and evicted so the next write reopens a fresh live
+// file at the original path rather than continuing to append to the
+// now-renamed segment.
+func (s *Shard) maybeRotate(sensorId uint32, dataDir *string) error {
+	if rotateThreshold <= 0 {
+		return nil
+	}
+	file, ok := s.files[sensorId]
+	if !ok {
+		return nil
+	}
+	info, err := file.Stat()
+	if err != nil || info.Size() < rotateThreshold {
+		return nil
+	}
+
+	filename := fmt.Sprintf("%s%d", *dataDir, sensorId)
+	seq := nextSegmentSeq(sensorId, *dataDir)
+	segmentName := fmt.Sprintf("%s.%d", filename, seq)
+	if err := os.Rename(filename, segmentName); err != nil {
+		return err
+	}
+	file.Close()
+	delete(s.files, sensorId)
+
+	return compressSegment(segmentName)
+}
+
+// compressSegment re-encodes segmentName through flate into
+// segmentName+".fl" and removes the uncompressed copy.
+func compressSegment(segmentName string) error {
+	in, err := os.Open(segmentName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(segmentName + ".fl")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer, err := flate.NewWriter(out, compressionLevel)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, in); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(segmentName)
+}
+
+// segment is one rotated-and-compressed chunk of a sensor's history.
+type segment struct {
+	seq  int
+	path string
+}
+
+// segmentsFor returns a sensor's compressed segments in ascending
+// sequence order, i.e. oldest first.
+func segmentsFor(sensorId uint32, dataDir string) []segment {
+	prefix := fmt.Sprintf("%d.", sensorId)
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil
+	}
+
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".fl") {
+			continue
+		}
+		rest := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".fl")
+		seq, err := strconv.Atoi(rest)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{seq: seq, path: dataDir + name})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments
+}
+
+// nextSegmentSeq returns the next unused segment number for a sensor.
+func nextSegmentSeq(sensorId uint32, dataDir string) int {
+	segments := segmentsFor(sensorId, dataDir)
+	if len(segments) == 0 {
+		return 0
+	}
+	return segments[len(segments)-1].seq + 1
+}
+
+// openSensorStream chains a sensor's compressed segments, oldest first,
+// with its live uncompressed file, so the read path can scan the whole
+// history as a single ordered stream. The returned closer must be called
+// once the caller is done reading. The sparse index only covers the live
+// file; seeking into compressed segments is left for a future pass since
+// decoding them is already a single cheap linear scan.
+func openSensorStream(sensorId uint32, dataDir *string, query ReadQuery) (io.Reader, func(), error) {
+	segments := segmentsFor(sensorId, *dataDir)
+
+	var readers []io.Reader
+	var closers []io.Closer
+	for _, seg := range segments {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			continue // listed when we scanned the dir, gone by the time we opened it
+		}
+		closers = append(closers, f)
+		fr := flate.NewReader(f)
+		closers = append(closers, fr)
+		readers = append(readers, fr)
+	}
+
+	filename := fmt.Sprintf("%s%d", *dataDir, sensorId)
+	live, err := os.Open(filename)
+	if err == nil {
+		if query.start != nil && len(segments) == 0 {
+			if offset := sparseIndex.seekOffset(sensorId, *query.start); offset > 0 {
+				live.Seek(offset, io.SeekStart)
+			}
+		}
+		closers = append(closers, live)
+		readers = append(readers, live)
+	}
+
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
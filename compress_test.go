@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeBatch drives a shard's write+maybeRotate exactly as Shard.run does
+// for each incoming WriteMessage, without needing a running shard pool.
+func writeBatch(t *testing.T, shard *Shard, dataDir *string, sensorId uint32, readings []Reading) {
+	t.Helper()
+	if err := shard.write(&Readings{Sensor_id: sensorId, Readings: readings}, dataDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := shard.maybeRotate(sensorId, dataDir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateCompressRoundTrip(t *testing.T) {
+	oldThreshold, oldLevel := rotateThreshold, compressionLevel
+	t.Cleanup(func() { rotateThreshold, compressionLevel = oldThreshold, oldLevel })
+	rotateThreshold = 60
+	compressionLevel = -1
+
+	dataDir := t.TempDir() + "/"
+	shard := newShard()
+	const sensorId = 1
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var want []Reading
+	for i := 0; i < 10; i++ {
+		reading := Reading{
+			Timestamp: base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+			Value:     float64(i),
+		}
+		want = append(want, reading)
+		writeBatch(t, shard, &dataDir, sensorId, []Reading{reading})
+	}
+
+	segments := segmentsFor(sensorId, dataDir)
+	if len(segments) == 0 {
+		t.Fatal("expected at least one rotated segment after writing past rotateThreshold")
+	}
+	for _, seg := range segments {
+		if _, err := os.Stat(seg.path); err != nil {
+			t.Fatalf("expected segment file to exist: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "1")); err != nil {
+		t.Fatalf("expected a fresh live file after rotation: %v", err)
+	}
+
+	got, err := read(sensorId, &dataDir, ReadQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readings := got.(*Readings)
+	if len(readings.Readings) != len(want) {
+		t.Fatalf("expected %d readings across segments + live file, got %d: %+v", len(want), len(readings.Readings), readings.Readings)
+	}
+	for i, reading := range readings.Readings {
+		if reading != want[i] {
+			t.Fatalf("reading %d: expected %+v, got %+v (segment+live merge is not in order)", i, want[i], reading)
+		}
+	}
+}
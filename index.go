@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexInterval controls how often we record a seek point: every Nth
+// line in a sensor's file gets an entry in the sparse index.
+const indexInterval = 1024
+
+// indexEntry is one seek point: the byte offset of the start of a line,
+// and the timestamp on that line.
+type indexEntry struct {
+	offset    int64
+	timestamp string
+}
+
+// SparseIndex holds a per-sensor list of seek points, built once on
+// startup, so a query with a start timestamp can seek close to the
+// right place in the file instead of scanning from byte 0.
+type SparseIndex struct {
+	mu      sync.RWMutex
+	entries map[uint32][]indexEntry
+}
+
+func newSparseIndex() *SparseIndex {
+	return &SparseIndex{entries: make(map[uint32][]indexEntry)}
+}
+
+var sparseIndex *SparseIndex
+
+// build scans every sensor file in dataDir once, recording a seek point
+// every indexInterval lines. It's only called at startup, so a full scan
+// here is fine even though the whole point of the index is to avoid full
+// scans later.
+func (idx *SparseIndex) build(dataDir string) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		log.Println("sparse index: could not read data dir:", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.Contains(entry.Name(), ".") {
+			continue // skip rotated/compressed segments, they aren't indexed yet
+		}
+		sensorId, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		idx.indexFile(uint32(sensorId), dataDir+entry.Name())
+	}
+}
+
+func (idx *SparseIndex) indexFile(sensorId uint32, filename string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var seekPoints []indexEntry
+	var offset int64
+	var line int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if line%indexInterval == 0 {
+			split := strings.SplitN(text, " ", 2)
+			seekPoints = append(seekPoints, indexEntry{offset: offset, timestamp: split[0]})
+		}
+		offset += int64(len(text)) + 1 // +1 for the newline Scanner strips
+		line++
+	}
+
+	idx.mu.Lock()
+	idx.entries[sensorId] = seekPoints
+	idx.mu.Unlock()
+}
+
+// seekOffset returns the largest indexed offset whose timestamp is <=
+// start, so a scan from there is guaranteed not to skip past start.
+func (idx *SparseIndex) seekOffset(sensorId uint32, start time.Time) int64 {
+	idx.mu.RLock()
+	seekPoints := idx.entries[sensorId]
+	idx.mu.RUnlock()
+
+	startStr := start.Format(time.RFC3339)
+	var offset int64
+	for _, e := range seekPoints {
+		if e.timestamp > startStr {
+			break
+		}
+		offset = e.offset
+	}
+	return offset
+}
@@ -0,0 +1,86 @@
+//go:build !fasthttp
+
+package main
+
+import (
+	"compress/flate"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func main() {
+	shards := flag.Int("shards", 8, "number of per-sensor shard workers")
+	tlsCert := flag.String("tls-cert", "", "path to TLS certificate; enables HTTPS with h2 ALPN negotiation")
+	tlsKey := flag.String("tls-key", "", "path to TLS private key; required alongside -tls-cert")
+	h2cFlag := flag.Bool("h2c", false, "serve plaintext HTTP/2 (h2c) instead of HTTP/1.1")
+	rotateSize := flag.Int64("rotate-size", 0, "rotate and flate-compress a sensor's file once it exceeds this many bytes (0 disables rotation)")
+	compressLevel := flag.Int("compress-level", flate.BestSpeed, "compress/flate level for rotated segments (1-9, or -1 default, -2 huffman-only)")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		log.Fatal("usage: sensor_service [flags] <port> <data-dir>")
+	}
+	port := args[0]
+	dataDir := args[1]
+
+	if *shards < 1 {
+		log.Fatal("-shards must be at least 1")
+	}
+
+	// separate pool of worker goroutines to handle stateful reads and
+	// writes safely, sharded by sensor_id
+	shardPool = newShardPool(*shards, &dataDir)
+
+	sparseIndex = newSparseIndex()
+	sparseIndex.build(dataDir)
+
+	rotateThreshold = *rotateSize
+	compressionLevel = *compressLevel
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", handleHello)
+	mux.HandleFunc("/readings", func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			getReading(&w, req)
+		case http.MethodPost:
+			postReading(&w, req)
+		default:
+			http.Error(w, "Undefined route", http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("/readings/stream", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Undefined route", http.StatusBadRequest)
+			return
+		}
+		postReadingStream(w, req)
+	})
+
+	// each request is handled on its own goroutine regardless of HTTP
+	// version, and the shard pool already serializes only within a
+	// sensor, so concurrent h2 streams fan out the same way concurrent
+	// h1 connections do
+	var handler http.Handler = mux
+	if *h2cFlag {
+		handler = h2c.NewHandler(mux, &http2.Server{})
+	}
+
+	println("data directory set to", dataDir)
+	println("listening on port", port)
+	println("sensor shards:", *shards)
+
+	addr := fmt.Sprintf(":%s", port)
+	if *tlsCert != "" || *tlsKey != "" {
+		println("TLS enabled, negotiating HTTP/2 via ALPN")
+		log.Fatal(http.ListenAndServeTLS(addr, *tlsCert, *tlsKey, handler))
+	} else {
+		log.Fatal(http.ListenAndServe(addr, handler))
+	}
+}
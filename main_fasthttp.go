@@ -0,0 +1,138 @@
+//go:build fasthttp
+
+package main
+
+import (
+	"compress/flate"
+	"encoding/json"
+	"flag"
+	"log"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// main is the fasthttp-backed entrypoint, built with `-tags fasthttp`
+// for deployments that need more throughput than net/http's
+// one-goroutine-per-connection model delivers. It only covers the core
+// GET/POST /readings routes; TLS/h2c, time-range queries and NDJNSON
+// streaming are still net/http-only.
+func main() {
+	shards := flag.Int("shards", 8, "number of per-sensor shard workers")
+	rotateSize := flag.Int64("rotate-size", 0, "rotate and flate-compress a sensor's file once it exceeds this many bytes (0 disables rotation)")
+	compressLevel := flag.Int("compress-level", flate.BestSpeed, "compress/flate level for rotated segments (1-9, or -1 default, -2 huffman-only)")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		log.Fatal("usage: sensor_service [flags] <port> <data-dir>")
+	}
+	port := args[0]
+	dataDir := args[1]
+
+	if *shards < 1 {
+		log.Fatal("-shards must be at least 1")
+	}
+
+	shardPool = newShardPool(*shards, &dataDir)
+	sparseIndex = newSparseIndex()
+	sparseIndex.build(dataDir)
+	rotateThreshold = *rotateSize
+	compressionLevel = *compressLevel
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case "/hello":
+			fasthttpHello(ctx)
+		case "/readings":
+			fasthttpReadings(ctx)
+		default:
+			ctx.Error("Undefined route", fasthttp.StatusBadRequest)
+		}
+	}
+
+	println("data directory set to", dataDir)
+	println("listening on port", port)
+	println("sensor shards:", *shards)
+	println("serving with fasthttp")
+	log.Fatal(fasthttp.ListenAndServe(":"+port, handler))
+}
+
+func fasthttpHello(ctx *fasthttp.RequestCtx) {
+	name := string(ctx.QueryArgs().Peek("name"))
+	if len(name) == 0 {
+		ctx.Error("Error: name not provided", fasthttp.StatusBadRequest)
+		return
+	}
+	ctx.SetContentType("application/json")
+	fasthttpWriteJSON(ctx, map[string]string{"message": "Hello " + name})
+}
+
+func fasthttpReadings(ctx *fasthttp.RequestCtx) {
+	switch {
+	case ctx.IsGet():
+		fasthttpGetReading(ctx)
+	case ctx.IsPost():
+		fasthttpPostReading(ctx)
+	default:
+		ctx.Error("Undefined route", fasthttp.StatusBadRequest)
+	}
+}
+
+func fasthttpGetReading(ctx *fasthttp.RequestCtx) {
+	sensorId := string(ctx.QueryArgs().Peek("sensor_id"))
+	if len(sensorId) == 0 {
+		ctx.Error("Error: sensor_id not provided", fasthttp.StatusBadRequest)
+		return
+	}
+	sId, err := strconv.ParseUint(sensorId, 10, 32)
+	if err != nil {
+		ctx.Error("invalid sensor id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	msg := readMessagePool.Get().(*ReadMessage)
+	msg.sensorId = uint32(sId)
+	msg.query = ReadQuery{}
+	shardPool.shardFor(uint32(sId)).readChannel <- msg
+	res := <-msg.result
+	readMessagePool.Put(msg)
+
+	if res.err != nil {
+		ctx.Error(res.err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	fasthttpWriteJSON(ctx, res.payload)
+}
+
+func fasthttpPostReading(ctx *fasthttp.RequestCtx) {
+	readings := readingsPool.Get().(*Readings)
+	readings.Sensor_id = 0
+	readings.Readings = readings.Readings[:0]
+
+	if err := json.Unmarshal(ctx.PostBody(), readings); err != nil {
+		readingsPool.Put(readings)
+		ctx.Error("Error: malformed request", fasthttp.StatusBadRequest)
+		return
+	}
+
+	msg := writeMessagePool.Get().(*WriteMessage)
+	msg.readings = readings
+	shardPool.shardFor(readings.Sensor_id).writeChannel <- msg
+	res := <-msg.result
+
+	readingsPool.Put(readings)
+	writeMessagePool.Put(msg)
+
+	if res.err != nil {
+		ctx.Error("Error Writing", fasthttp.StatusBadRequest)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+}
+
+func fasthttpWriteJSON(ctx *fasthttp.RequestCtx, v interface{}) {
+	body, _ := json.Marshal(v)
+	ctx.SetContentType("application/json")
+	ctx.Write(body)
+}
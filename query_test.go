@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseRFC3339(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestFilterReadingsUnfilteredPassesNonRFC3339Through(t *testing.T) {
+	data := "2020-01-01T00:00:00Z 1\nnot-a-timestamp 2\n2020-01-01T00:01:00Z 3\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+
+	res, err := filterReadings(scanner, 7, ReadQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Readings) != 3 {
+		t.Fatalf("expected all 3 rows passed through unfiltered, got %d: %+v", len(res.Readings), res.Readings)
+	}
+}
+
+func TestFilterReadingsStartEnd(t *testing.T) {
+	data := "2020-01-01T00:00:00Z 1\n2020-01-01T00:01:00Z 2\n2020-01-01T00:02:00Z 3\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	start := parseRFC3339(t, "2020-01-01T00:01:00Z")
+
+	res, err := filterReadings(scanner, 1, ReadQuery{start: &start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Readings) != 2 {
+		t.Fatalf("expected 2 readings at/after start, got %d: %+v", len(res.Readings), res.Readings)
+	}
+}
+
+func TestFilterReadingsDropsUnparseableRowsWhenTimeFilterRequested(t *testing.T) {
+	data := "2020-01-01T00:00:00Z 1\nnot-a-timestamp 2\n2020-01-01T00:02:00Z 3\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	start := parseRFC3339(t, "2020-01-01T00:00:00Z")
+
+	res, err := filterReadings(scanner, 1, ReadQuery{start: &start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Readings) != 2 {
+		t.Fatalf("expected the unparseable row dropped once a time filter needs it, got %d: %+v", len(res.Readings), res.Readings)
+	}
+}
+
+func TestFilterReadingsOutOfOrderRowsStillFilteredAndSorted(t *testing.T) {
+	// later timestamp appended before earlier ones, e.g. two POSTs that
+	// landed out of order, or an unsorted batch within one POST
+	data := "2020-01-01T00:05:00Z 5\n2020-01-01T00:01:00Z 1\n2020-01-01T00:02:00Z 2\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	end := parseRFC3339(t, "2020-01-01T00:02:00Z")
+
+	res, err := filterReadings(scanner, 1, ReadQuery{end: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Readings) != 2 {
+		t.Fatalf("expected 2 readings within end despite out-of-order append, got %d: %+v", len(res.Readings), res.Readings)
+	}
+	if res.Readings[0].Timestamp != "2020-01-01T00:01:00Z" || res.Readings[1].Timestamp != "2020-01-01T00:02:00Z" {
+		t.Fatalf("expected result sorted by timestamp, got %+v", res.Readings)
+	}
+}
+
+func TestFilterReadingsLimitAppliedAfterSort(t *testing.T) {
+	data := "2020-01-01T00:05:00Z 5\n2020-01-01T00:01:00Z 1\n2020-01-01T00:02:00Z 2\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+
+	res, err := filterReadings(scanner, 1, ReadQuery{limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Readings) != 2 {
+		t.Fatalf("expected limit of 2, got %d: %+v", len(res.Readings), res.Readings)
+	}
+	if res.Readings[0].Timestamp != "2020-01-01T00:01:00Z" || res.Readings[1].Timestamp != "2020-01-01T00:02:00Z" {
+		t.Fatalf("expected the earliest 2 readings after sorting, got %+v", res.Readings)
+	}
+}
+
+func TestAggregateAvg(t *testing.T) {
+	data := "2020-01-01T00:00:00Z 1\n2020-01-01T00:00:30Z 3\n2020-01-01T00:01:00Z 5\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+
+	res, err := aggregate(scanner, ReadQuery{agg: "avg", bucket: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 buckets, got %d: %+v", len(res), res)
+	}
+	if res[0].Value != 2 {
+		t.Fatalf("expected first bucket avg of 2, got %v", res[0].Value)
+	}
+	if res[1].Value != 5 {
+		t.Fatalf("expected second bucket avg of 5, got %v", res[1].Value)
+	}
+}
+
+func TestAggregateOutOfOrderRowsStillBucketCorrectly(t *testing.T) {
+	data := "2020-01-01T00:01:00Z 5\n2020-01-01T00:00:00Z 1\n2020-01-01T00:00:30Z 3\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+
+	res, err := aggregate(scanner, ReadQuery{agg: "count", bucket: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 buckets despite out-of-order append, got %d: %+v", len(res), res)
+	}
+	if res[0].Start != "2020-01-01T00:00:00Z" || res[0].Value != 2 {
+		t.Fatalf("expected first bucket to have 2 rows, got %+v", res[0])
+	}
+}
+
+func TestAggregateDropsUnparseableRows(t *testing.T) {
+	data := "2020-01-01T00:00:00Z 1\nnot-a-timestamp 2\n"
+	scanner := bufio.NewScanner(strings.NewReader(data))
+
+	res, err := aggregate(scanner, ReadQuery{agg: "count", bucket: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Value != 1 {
+		t.Fatalf("expected the unparseable row dropped since agg requires a timestamp, got %+v", res)
+	}
+}
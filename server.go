@@ -7,9 +7,8 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"sort"
 	"strconv"
-	"strings"
+	"sync"
 )
 
 func handleHello(w http.ResponseWriter, req *http.Request) {
@@ -31,136 +30,254 @@ type Readings struct {
 	Readings  []Reading `json:"readings"`
 }
 
+// readingsPool and writeMessagePool/readMessagePool let the hot path
+// reuse request-scoped objects instead of allocating one of each per
+// request. Pooled *WriteMessage/*ReadMessage keep their own result
+// channel alive across reuses, so the channel itself is only allocated
+// once per pool slot rather than once per request.
+var readingsPool = sync.Pool{
+	New: func() interface{} { return new(Readings) },
+}
+
 func getReading(w *http.ResponseWriter, req *http.Request) {
 	sensorId := req.FormValue("sensor_id")
-	if len(sensorId) > 0 {
-		sId, err := strconv.ParseUint(sensorId, 10, 32)
-		if err != nil {
-			http.Error(*w, "invalid sensor id", http.StatusBadRequest)
-		} else {
-			// go makes deferring responses to different threads overly complicated
-			// each handler automatically sets the header response code to 200 when it returns and nothing is done in its lifetime
-			done := make(chan bool)
-			readChannel <- ReadMessage{uint32(sId), w, &done}
-			// keeps this goroutine on the call stack so that we don't write multiple times
-			<-done
-		}
-	} else {
+	if len(sensorId) == 0 {
 		http.Error(*w, "Error: sensor_id not provided", http.StatusBadRequest)
+		return
+	}
+	sId, err := strconv.ParseUint(sensorId, 10, 32)
+	if err != nil {
+		http.Error(*w, "invalid sensor id", http.StatusBadRequest)
+		return
+	}
+	query, err := parseReadQuery(req)
+	if err != nil {
+		http.Error(*w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := readMessagePool.Get().(*ReadMessage)
+	msg.sensorId = uint32(sId)
+	msg.query = query
+	shardPool.shardFor(uint32(sId)).readChannel <- msg
+	// keeps this goroutine on the call stack so that we don't write multiple times
+	res := <-msg.result
+	readMessagePool.Put(msg)
+
+	if res.err != nil {
+		http.Error(*w, res.err.Error(), http.StatusBadRequest)
+		return
 	}
+	payload, _ := json.Marshal(res.payload)
+	(*w).Write(payload)
 }
 
 func postReading(w *http.ResponseWriter, req *http.Request) {
-	decoder := json.NewDecoder(req.Body)
-	var readings Readings
-	err := decoder.Decode(&readings)
-	if err != nil {
+	readings := readingsPool.Get().(*Readings)
+	readings.Sensor_id = 0
+	readings.Readings = readings.Readings[:0]
+
+	if err := json.NewDecoder(req.Body).Decode(readings); err != nil {
+		readingsPool.Put(readings)
 		http.Error(*w, "Error: malformed request", http.StatusBadRequest)
+		return
+	}
+
+	msg := writeMessagePool.Get().(*WriteMessage)
+	msg.readings = readings
+	shardPool.shardFor(readings.Sensor_id).writeChannel <- msg
+	res := <-msg.result
+
+	readingsPool.Put(readings)
+	writeMessagePool.Put(msg)
+
+	if res.err != nil {
+		http.Error(*w, "Error Writing", http.StatusBadRequest)
 	} else {
-		done := make(chan bool)
-		writeChannel <- WriteMessage{readings, w, &done}
-		<-done
+		(*w).WriteHeader(http.StatusCreated)
 	}
 }
 
 // use channels to make concurrent requests safe, i.e. to make partial reads impossible
 type ReadMessage struct {
 	sensorId uint32
-	writer   *http.ResponseWriter
-	done     *chan bool
+	query    ReadQuery
+	result   chan Result
 }
 
 type WriteMessage struct {
-	readings Readings
-	writer   *http.ResponseWriter
-	done     *chan bool
+	readings *Readings
+	result   chan Result
+}
+
+var readMessagePool = sync.Pool{
+	New: func() interface{} { return &ReadMessage{result: make(chan Result)} },
+}
+
+var writeMessagePool = sync.Pool{
+	New: func() interface{} { return &WriteMessage{result: make(chan Result)} },
+}
+
+// Result is handed back over a request's result channel once the owning
+// shard has finished processing it. For a write, only err is meaningful.
+// For a read, payload holds either a *Readings or a []Bucket, depending
+// on whether query.agg was set.
+type Result struct {
+	payload interface{}
+	err     error
 }
 
-var readChannel = make(chan ReadMessage)
-var writeChannel = make(chan WriteMessage)
+// channelBuffer bounds how many in-flight requests a single shard will
+// queue before its senders start blocking.
+const channelBuffer = 64
 
-// called on a different thread, handles read/writing to files in a continuous loop
-func readWriteRoutine(dataDir *string) {
+// bufWriterPool reuses the *bufio.Writer used to append readings to a
+// sensor's file, avoiding one more allocation per write once the pool
+// has warmed up.
+var bufWriterPool = sync.Pool{
+	New: func() interface{} { return bufio.NewWriterSize(nil, 4096) },
+}
+
+// floatBufPool holds the scratch buffer strconv.AppendFloat writes
+// into. A plain stack array still escapes to heap here because
+// AppendFloat's escape summary can't prove the returned slice doesn't
+// outlive the call, so pooling it is what actually gets write() to
+// zero steady-state allocations.
+var floatBufPool = sync.Pool{
+	New: func() interface{} { b := make([]byte, 0, 32); return &b },
+}
+
+// Shard owns one worker goroutine and the read/write channels for every
+// sensor ID hashed onto it. Requests for different shards run in
+// parallel; requests within the same shard are serialized, which is what
+// preserves file append order and the read-after-write guarantee. Since
+// a shard's files map is only ever touched from its own goroutine, it
+// needs no locking.
+type Shard struct {
+	readChannel  chan *ReadMessage
+	writeChannel chan *WriteMessage
+	files        map[uint32]*os.File
+}
+
+func newShard() *Shard {
+	return &Shard{
+		readChannel:  make(chan *ReadMessage, channelBuffer),
+		writeChannel: make(chan *WriteMessage, channelBuffer),
+		files:        make(map[uint32]*os.File),
+	}
+}
+
+// run is the per-shard worker loop, handling read/writing to files for
+// every sensor hashed onto this shard.
+func (s *Shard) run(dataDir *string) {
 	for {
 		select {
-		case readMessage := <-readChannel:
-			w := readMessage.writer
-			readings := read(readMessage.sensorId, dataDir)
-			readingsString, _ := json.Marshal(readings)
-			(*w).Write([]byte(readingsString))
-			(*readMessage.done) <- true
-		case readings := <-writeChannel:
-			w := readings.writer
-			err := write(readings.readings, dataDir)
-			if err != nil {
-				http.Error(*w, "Error Writing", http.StatusBadRequest)
-			} else {
-				(*w).WriteHeader(http.StatusCreated)
+		case readMessage := <-s.readChannel:
+			payload, err := read(readMessage.sensorId, dataDir, readMessage.query)
+			readMessage.result <- Result{payload: payload, err: err}
+		case writeMessage := <-s.writeChannel:
+			err := s.write(writeMessage.readings, dataDir)
+			if err == nil {
+				if rotErr := s.maybeRotate(writeMessage.readings.Sensor_id, dataDir); rotErr != nil {
+					log.Println("rotate:", rotErr)
+				}
 			}
-			(*readings.done) <- true
+			writeMessage.result <- Result{err: err}
 		}
 	}
 }
 
-// lower level write writes readings to a file
-func write(readings Readings, dataDir *string) error {
-	filename := fmt.Sprintf("%s%d", *dataDir, readings.Sensor_id)
+// fileFor returns the sensor's live file, opening and caching it on
+// first use so later writes for the same sensor (which can only ever
+// land on this shard) skip the OpenFile syscall.
+func (s *Shard) fileFor(sensorId uint32, dataDir *string) (*os.File, error) {
+	if file, ok := s.files[sensorId]; ok {
+		return file, nil
+	}
+	filename := fmt.Sprintf("%s%d", *dataDir, sensorId)
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.files[sensorId] = file
+	return file, nil
+}
+
+// ShardPool fans sensor IDs out across a fixed number of shards so a slow
+// read for one sensor can no longer block a write for another.
+type ShardPool struct {
+	shards []*Shard
+}
+
+func newShardPool(n int, dataDir *string) *ShardPool {
+	pool := &ShardPool{shards: make([]*Shard, n)}
+	for i := range pool.shards {
+		pool.shards[i] = newShard()
+		go pool.shards[i].run(dataDir)
+	}
+	return pool
+}
+
+// shardFor returns the shard responsible for sensorId. Keeping the same
+// sensor on the same shard is what guarantees ordering for that sensor.
+func (p *ShardPool) shardFor(sensorId uint32) *Shard {
+	return p.shards[sensorId%uint32(len(p.shards))]
+}
+
+var shardPool *ShardPool
+
+// write appends readings to the sensor's cached file. Timestamp/value
+// pairs are written with strconv.AppendFloat into a pooled buffer
+// rather than fmt.Fprintln, which would box reading.Value into an
+// interface{} and allocate on every call.
+func (s *Shard) write(readings *Readings, dataDir *string) error {
+	file, err := s.fileFor(readings.Sensor_id, dataDir)
 	if err != nil {
 		log.Println(err)
 		return err
-	} else {
-		defer file.Close()
-		writer := bufio.NewWriter(file)
-		for _, reading := range readings.Readings {
-			fmt.Fprintln(writer, reading.Timestamp, reading.Value)
-		}
-		writer.Flush()
-		return nil
 	}
+
+	writer := bufWriterPool.Get().(*bufio.Writer)
+	writer.Reset(file)
+
+	floatBuf := floatBufPool.Get().(*[]byte)
+	for _, reading := range readings.Readings {
+		writer.WriteString(reading.Timestamp)
+		writer.WriteByte(' ')
+		*floatBuf = strconv.AppendFloat((*floatBuf)[:0], reading.Value, 'g', -1, 64)
+		writer.Write(*floatBuf)
+		writer.WriteByte('\n')
+	}
+	floatBufPool.Put(floatBuf)
+
+	err = writer.Flush()
+	bufWriterPool.Put(writer)
+	return err
 }
 
-// reads readings from the file it belongs to
-func read(sensorId uint32, dataDir *string) *Readings {
-	filename := fmt.Sprintf("%s%d", *dataDir, sensorId)
-	file, err := os.Open(filename)
-	if err != nil { // there's actually no error. sensor just doesnt exist
-		return &Readings{Sensor_id: sensorId, Readings: []Reading{}}
-	} else {
-		defer file.Close()
-		var readings []Reading
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			split := strings.Split(scanner.Text(), " ")
-			value, _ := strconv.ParseFloat(split[1], 64)
-			readings = append(readings, Reading{
-				Timestamp: split[0],
-				Value:     value,
-			})
+// read streams a sensor's compressed segments and live file as one
+// history, applying query's start/end/agg filters while scanning rather
+// than buffering the raw file lines. filterReadings/aggregate still sort
+// and apply limit over the (usually much smaller) filtered result, since
+// neither a POST batch nor a sequence of POSTs is required to be
+// monotonic.
+func read(sensorId uint32, dataDir *string, query ReadQuery) (interface{}, error) {
+	reader, closeStream, err := openSensorStream(sensorId, dataDir, query)
+	if err != nil {
+		return nil, err
+	}
+	defer closeStream()
+
+	scanner := bufio.NewScanner(reader)
+	if query.agg != "" {
+		buckets, err := aggregate(scanner, query)
+		if err != nil {
+			return nil, err
 		}
-		sort.Slice(readings, func(i, j int) bool { return readings[i].Timestamp < readings[j].Timestamp })
-		return &Readings{sensorId, readings}
-	}
-}
-
-func main() {
-	port := os.Args[1]
-	dataDir := os.Args[2]
-	// separate routine to handle stateful reads and writes safely
-	go readWriteRoutine(&dataDir)
-	http.HandleFunc("/hello", handleHello)
-	http.HandleFunc("/readings", func(w http.ResponseWriter, req *http.Request) {
-		switch req.Method {
-		case http.MethodGet:
-			getReading(&w, req)
-		case http.MethodPost:
-			postReading(&w, req)
-		default:
-			http.Error(w, "Undefined route", http.StatusBadRequest)
+		if buckets == nil {
+			buckets = []Bucket{}
 		}
-	})
-
-	println("data directory set to", dataDir)
-	println("listening on port", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+		return buckets, nil
+	}
+	return filterReadings(scanner, sensorId, query)
 }
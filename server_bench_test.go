@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// setupShardPool points a fresh ShardPool at a temp data dir so benchmarks
+// don't trample each other's files or a developer's working tree.
+func setupShardPool(b *testing.B, shards int) {
+	b.Helper()
+	dataDir := b.TempDir() + "/"
+	shardPool = newShardPool(shards, &dataDir)
+}
+
+func postBody(sensorId uint32, n int) []byte {
+	readings := make([]Reading, n)
+	for i := range readings {
+		readings[i] = Reading{Timestamp: "2020-01-01T00:00:00Z", Value: float64(i)}
+	}
+	body, _ := json.Marshal(Readings{Sensor_id: sensorId, Readings: readings})
+	return body
+}
+
+// postBodies precomputes one POST body per sensor ID so the benchmark
+// loops below can pick one by sensorId without marshaling JSON on every
+// iteration.
+func postBodies(numSensors int) [][]byte {
+	bodies := make([][]byte, numSensors)
+	for i := range bodies {
+		bodies[i] = postBody(uint32(i), 1)
+	}
+	return bodies
+}
+
+// benchmarkPost drives postReading with requests spread across numSensors
+// sensor IDs, so higher shard counts should parallelize across more of
+// them.
+func benchmarkPost(b *testing.B, shards, numSensors int) {
+	setupShardPool(b, shards)
+	bodies := postBodies(numSensors)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i uint32
+		for pb.Next() {
+			sensorId := i % uint32(numSensors)
+			req := httptest.NewRequest(http.MethodPost, "/readings", bytes.NewReader(bodies[sensorId]))
+			w := httptest.NewRecorder()
+			var rw http.ResponseWriter = w
+			postReading(&rw, req)
+			i++
+		}
+	})
+}
+
+// benchmarkMixed drives a 50/50 mix of GET and POST across numSensors
+// sensor IDs, mirroring the read-after-write traffic shape this service
+// actually sees.
+func benchmarkMixed(b *testing.B, shards, numSensors int) {
+	setupShardPool(b, shards)
+	bodies := postBodies(numSensors)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i uint32
+		for pb.Next() {
+			sensorId := i % uint32(numSensors)
+			if i%2 == 0 {
+				req := httptest.NewRequest(http.MethodPost, "/readings", bytes.NewReader(bodies[sensorId]))
+				w := httptest.NewRecorder()
+				var rw http.ResponseWriter = w
+				postReading(&rw, req)
+			} else {
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/readings?sensor_id=%d", sensorId), nil)
+				w := httptest.NewRecorder()
+				var rw http.ResponseWriter = w
+				getReading(&rw, req)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkPost_1Shard(b *testing.B)   { benchmarkPost(b, 1, 100) }
+func BenchmarkPost_4Shards(b *testing.B)  { benchmarkPost(b, 4, 100) }
+func BenchmarkPost_16Shards(b *testing.B) { benchmarkPost(b, 16, 100) }
+
+func BenchmarkMixed_1Shard(b *testing.B)   { benchmarkMixed(b, 1, 100) }
+func BenchmarkMixed_4Shards(b *testing.B)  { benchmarkMixed(b, 4, 100) }
+func BenchmarkMixed_16Shards(b *testing.B) { benchmarkMixed(b, 16, 100) }
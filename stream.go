@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// StreamReading is one line of the newline-delimited JSON body accepted
+// by POST /readings/stream: a single reading with its sensor_id inlined,
+// rather than a Readings batch.
+type StreamReading struct {
+	SensorId  uint32  `json:"sensor_id"`
+	Timestamp string  `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// streamAck is the per-line response written to an NDJSON ingest client
+// as soon as that line's reading has been durably written (or rejected).
+type streamAck struct {
+	Ok   bool   `json:"ok"`
+	Line int    `json:"line"`
+	Err  string `json:"err,omitempty"`
+}
+
+// postReadingStream consumes newline-delimited JSON readings from the
+// request body, dispatching each one to its sensor's shard as it's
+// decoded instead of buffering the whole body. It writes one ack per
+// line and flushes immediately so a long-lived client sees backpressure
+// rather than having acks buffered up behind the response.
+func postReadingStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	decoder := json.NewDecoder(req.Body)
+	encoder := json.NewEncoder(w)
+	line := 0
+	for decoder.More() {
+		line++
+
+		var sr StreamReading
+		if err := decoder.Decode(&sr); err != nil {
+			encoder.Encode(streamAck{Line: line, Err: err.Error()})
+			flusher.Flush()
+			return // body is no longer parseable as JSON, nothing left to salvage
+		}
+
+		readings := readingsPool.Get().(*Readings)
+		readings.Sensor_id = sr.SensorId
+		readings.Readings = append(readings.Readings[:0], Reading{Timestamp: sr.Timestamp, Value: sr.Value})
+
+		msg := writeMessagePool.Get().(*WriteMessage)
+		msg.readings = readings
+		shardPool.shardFor(sr.SensorId).writeChannel <- msg
+		res := <-msg.result
+
+		readingsPool.Put(readings)
+		writeMessagePool.Put(msg)
+
+		ack := streamAck{Line: line}
+		if res.err != nil {
+			ack.Err = res.err.Error()
+		} else {
+			ack.Ok = true
+		}
+		encoder.Encode(ack)
+		flusher.Flush()
+	}
+}
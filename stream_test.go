@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostReadingStreamAcksAndPersists(t *testing.T) {
+	dataDir := t.TempDir() + "/"
+	shardPool = newShardPool(1, &dataDir)
+
+	body := `{"sensor_id":1,"timestamp":"2020-01-01T00:00:00Z","value":1}
+{"sensor_id":1,"timestamp":"2020-01-01T00:01:00Z","value":2}
+`
+	req := httptest.NewRequest(http.MethodPost, "/readings/stream", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	postReadingStream(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("expected application/x-ndjson content type, got %q", ct)
+	}
+
+	var acks []streamAck
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		var ack streamAck
+		if err := json.Unmarshal(scanner.Bytes(), &ack); err != nil {
+			t.Fatalf("ack line %q did not decode: %v", scanner.Text(), err)
+		}
+		acks = append(acks, ack)
+	}
+	if len(acks) != 2 {
+		t.Fatalf("expected one ack per line, got %d: %+v", len(acks), acks)
+	}
+	for i, ack := range acks {
+		if !ack.Ok || ack.Line != i+1 || ack.Err != "" {
+			t.Fatalf("expected ack %d to be ok with no err, got %+v", i, ack)
+		}
+	}
+
+	readResult, err := read(1, &dataDir, ReadQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readings := readResult.(*Readings)
+	if len(readings.Readings) != 2 {
+		t.Fatalf("expected both streamed readings to be persisted, got %d: %+v", len(readings.Readings), readings.Readings)
+	}
+}
+
+func TestPostReadingStreamStopsAndAcksErrOnMalformedLine(t *testing.T) {
+	dataDir := t.TempDir() + "/"
+	shardPool = newShardPool(1, &dataDir)
+
+	body := `{"sensor_id":1,"timestamp":"2020-01-01T00:00:00Z","value":1}
+not json
+{"sensor_id":1,"timestamp":"2020-01-01T00:02:00Z","value":3}
+`
+	req := httptest.NewRequest(http.MethodPost, "/readings/stream", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	postReadingStream(w, req)
+
+	var acks []streamAck
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		var ack streamAck
+		if err := json.Unmarshal(scanner.Bytes(), &ack); err != nil {
+			t.Fatalf("ack line %q did not decode: %v", scanner.Text(), err)
+		}
+		acks = append(acks, ack)
+	}
+	if len(acks) != 2 {
+		t.Fatalf("expected processing to stop at the malformed line, got %d acks: %+v", len(acks), acks)
+	}
+	if !acks[0].Ok {
+		t.Fatalf("expected line 1 to succeed, got %+v", acks[0])
+	}
+	if acks[1].Ok || acks[1].Err == "" {
+		t.Fatalf("expected line 2 to be acked as a decode failure, got %+v", acks[1])
+	}
+}